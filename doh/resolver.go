@@ -0,0 +1,311 @@
+// Package doh implements httpsrv.Resolver on top of RFC 8484 DNS-over-HTTPS,
+// so that SRV records can be resolved against an internal DoH endpoint instead
+// of the host resolver. This is useful in containerized environments where the
+// system DNS can't see Consul/etcd SRV records but an internal DoH endpoint can.
+package doh
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"tired-engineer/httpsrv"
+)
+
+const dnsMessageContentType = "application/dns-message"
+
+const (
+	dnsTypeSRV   = 33
+	dnsClassINET = 1
+)
+
+var _ httpsrv.Resolver = (*Resolver)(nil)
+
+// Resolver resolves SRV records by issuing RFC 8484 DNS-over-HTTPS queries
+// against endpoint (e.g. "https://cloudflare-dns.com/dns-query").
+type Resolver struct {
+	endpoint string
+	client   *http.Client
+	method   string
+}
+
+// Option configures a Resolver.
+type Option func(*Resolver)
+
+// WithHTTPClient overrides the *http.Client used to issue DoH queries, so
+// callers can layer their own auth, proxying or TLS pinning on top.
+func WithHTTPClient(client *http.Client) Option {
+	return func(r *Resolver) { r.client = client }
+}
+
+// WithMethod selects the HTTP method used for DoH queries: http.MethodGet
+// (base64url-encoded in the "dns" query parameter) or http.MethodPost (raw
+// wire format body). Defaults to http.MethodPost.
+func WithMethod(method string) Option {
+	return func(r *Resolver) { r.method = method }
+}
+
+// NewResolver returns a Resolver that queries the given DoH endpoint.
+func NewResolver(endpoint string, opts ...Option) *Resolver {
+	r := &Resolver{
+		endpoint: endpoint,
+		client:   http.DefaultClient,
+		method:   http.MethodPost,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// LookupSRV implements httpsrv.Resolver.
+func (r *Resolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, time.Duration, error) {
+	query := name
+	if service != "" || proto != "" {
+		query = fmt.Sprintf("_%s._%s.%s", service, proto, name)
+	}
+	if !strings.HasSuffix(query, ".") {
+		query += "."
+	}
+
+	msg, err := buildQuery(query)
+	if err != nil {
+		return "", nil, 0, fmt.Errorf("httpsrv/doh: building query for %s: %w", query, err)
+	}
+
+	respMsg, err := r.exchange(ctx, msg)
+	if err != nil {
+		return "", nil, 0, fmt.Errorf("httpsrv/doh: querying %s for %s: %w", r.endpoint, query, err)
+	}
+
+	addrs, ttl, err := parseSRVAnswer(respMsg)
+	if err != nil {
+		return "", nil, 0, fmt.Errorf("httpsrv/doh: parsing response for %s: %w", query, err)
+	}
+
+	return query, addrs, ttl, nil
+}
+
+func (r *Resolver) exchange(ctx context.Context, msg []byte) ([]byte, error) {
+	var req *http.Request
+	var err error
+	switch r.method {
+	case http.MethodGet:
+		getURL, parseErr := url.Parse(r.endpoint)
+		if parseErr != nil {
+			return nil, fmt.Errorf("parsing endpoint %q: %w", r.endpoint, parseErr)
+		}
+		query := getURL.Query()
+		query.Set("dns", base64.RawURLEncoding.EncodeToString(msg))
+		getURL.RawQuery = query.Encode()
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, getURL.String(), nil)
+	case http.MethodPost, "":
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(msg))
+		if err == nil {
+			req.Header.Set("Content-Type", dnsMessageContentType)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported method %q", r.method)
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", dnsMessageContentType)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// buildQuery encodes a minimal RFC 1035 query message asking for the SRV
+// records of name.
+func buildQuery(name string) ([]byte, error) {
+	qname, err := encodeName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	header := [6]uint16{
+		uint16(rand.Intn(1 << 16)), // ID
+		0x0100,                     // flags: recursion desired
+		1,                          // QDCOUNT
+		0,                          // ANCOUNT
+		0,                          // NSCOUNT
+		0,                          // ARCOUNT
+	}
+	for _, field := range header {
+		if err := binary.Write(&buf, binary.BigEndian, field); err != nil {
+			return nil, err
+		}
+	}
+	buf.Write(qname)
+	binary.Write(&buf, binary.BigEndian, uint16(dnsTypeSRV))
+	binary.Write(&buf, binary.BigEndian, uint16(dnsClassINET))
+
+	return buf.Bytes(), nil
+}
+
+// encodeName encodes name as a sequence of length-prefixed DNS labels.
+func encodeName(name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+
+	var buf bytes.Buffer
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 || len(label) > 63 {
+				return nil, fmt.Errorf("invalid DNS label %q", label)
+			}
+			buf.WriteByte(byte(len(label)))
+			buf.WriteString(label)
+		}
+	}
+	buf.WriteByte(0)
+
+	return buf.Bytes(), nil
+}
+
+// readName decodes the (possibly compressed, per RFC 1035 section 4.1.4) DNS
+// name starting at offset in msg. It returns the decoded name and the offset
+// immediately following it in the enclosing record, which for a compressed
+// name is right after the 2-byte pointer rather than wherever the pointer
+// jumped to.
+func readName(msg []byte, offset int) (string, int, error) {
+	var labels []string
+	pos := offset
+	next := -1
+	jumps := 0
+
+	for {
+		if pos >= len(msg) {
+			return "", 0, io.ErrUnexpectedEOF
+		}
+		b := msg[pos]
+
+		if b&0xC0 == 0xC0 {
+			if pos+1 >= len(msg) {
+				return "", 0, io.ErrUnexpectedEOF
+			}
+			// Compression pointers always point backwards in a well-formed message, so
+			// there can be at most len(msg) of them before a loop is guaranteed; bail out
+			// rather than spin forever on a malformed or malicious response.
+			jumps++
+			if jumps > len(msg) {
+				return "", 0, fmt.Errorf("dns message name has too many compression pointer jumps")
+			}
+			if next == -1 {
+				next = pos + 2
+			}
+			pos = int(binary.BigEndian.Uint16(msg[pos:pos+2]) & 0x3FFF)
+			continue
+		}
+
+		if b == 0 {
+			pos++
+			if next == -1 {
+				next = pos
+			}
+			break
+		}
+
+		length := int(b)
+		pos++
+		if pos+length > len(msg) {
+			return "", 0, io.ErrUnexpectedEOF
+		}
+		labels = append(labels, string(msg[pos:pos+length]))
+		pos += length
+	}
+
+	name := strings.Join(labels, ".")
+	if name != "" {
+		name += "."
+	}
+	return name, next, nil
+}
+
+// parseSRVAnswer extracts the SRV records and minimum TTL out of a raw DNS
+// response message. Records of other types in the answer section are ignored.
+func parseSRVAnswer(msg []byte) ([]*net.SRV, time.Duration, error) {
+	const headerLen = 12
+	if len(msg) < headerLen {
+		return nil, 0, fmt.Errorf("response too short: %d bytes", len(msg))
+	}
+	if rcode := msg[3] & 0x0F; rcode != 0 {
+		return nil, 0, fmt.Errorf("dns response code %d", rcode)
+	}
+
+	qdcount := int(binary.BigEndian.Uint16(msg[4:6]))
+	ancount := int(binary.BigEndian.Uint16(msg[6:8]))
+
+	offset := headerLen
+	for i := 0; i < qdcount; i++ {
+		_, next, err := readName(msg, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset = next + 4 // QTYPE + QCLASS
+	}
+
+	var addrs []*net.SRV
+	var minTTL time.Duration
+	haveTTL := false
+
+	for i := 0; i < ancount; i++ {
+		_, next, err := readName(msg, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset = next
+
+		if offset+10 > len(msg) {
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+		rrType := binary.BigEndian.Uint16(msg[offset : offset+2])
+		ttl := binary.BigEndian.Uint32(msg[offset+4 : offset+8])
+		rdlength := int(binary.BigEndian.Uint16(msg[offset+8 : offset+10]))
+		rdataOffset := offset + 10
+		if rdataOffset+rdlength > len(msg) {
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+
+		if rrType == dnsTypeSRV {
+			if rdlength < 6 {
+				return nil, 0, fmt.Errorf("malformed SRV record")
+			}
+			priority := binary.BigEndian.Uint16(msg[rdataOffset : rdataOffset+2])
+			weight := binary.BigEndian.Uint16(msg[rdataOffset+2 : rdataOffset+4])
+			port := binary.BigEndian.Uint16(msg[rdataOffset+4 : rdataOffset+6])
+			target, _, err := readName(msg, rdataOffset+6)
+			if err != nil {
+				return nil, 0, err
+			}
+			addrs = append(addrs, &net.SRV{Target: target, Port: port, Priority: priority, Weight: weight})
+
+			d := time.Duration(ttl) * time.Second
+			if !haveTTL || d < minTTL {
+				minTTL, haveTTL = d, true
+			}
+		}
+
+		offset = rdataOffset + rdlength
+	}
+
+	return addrs, minTTL, nil
+}
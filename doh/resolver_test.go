@@ -0,0 +1,258 @@
+package doh
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEncodeName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected []byte
+	}{
+		{"example.com.", []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}},
+		{"example.com", []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}},
+		{".", []byte{0}},
+	}
+	for _, tt := range tests {
+		got, err := encodeName(tt.name)
+		if err != nil {
+			t.Fatalf("encodeName(%q) failed: %v", tt.name, err)
+		}
+		if string(got) != string(tt.expected) {
+			t.Errorf("encodeName(%q) = %v, want %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestEncodeName_LabelTooLong(t *testing.T) {
+	longLabel := make([]byte, 64)
+	for i := range longLabel {
+		longLabel[i] = 'a'
+	}
+	if _, err := encodeName(string(longLabel) + ".com."); err == nil {
+		t.Fatal("expected an error for an over-long label, got nil")
+	}
+}
+
+// buildSRVResponse crafts a minimal, well-formed DNS response with a single
+// question and a single SRV answer, using name compression to point the
+// answer's owner name back at the question (as real DNS servers do).
+func buildSRVResponse(t *testing.T, query string, srv struct {
+	Priority, Weight, Port uint16
+	Target                 string
+}, ttl uint32) []byte {
+	t.Helper()
+
+	qname, err := encodeName(query)
+	if err != nil {
+		t.Fatalf("encodeName: %v", err)
+	}
+
+	var buf []byte
+	appendUint16 := func(v uint16) { buf = binary.BigEndian.AppendUint16(buf, v) }
+	appendUint32 := func(v uint32) { buf = binary.BigEndian.AppendUint32(buf, v) }
+
+	appendUint16(0x1234) // ID
+	appendUint16(0x8180) // flags: response, recursion available, no error
+	appendUint16(1)      // QDCOUNT
+	appendUint16(1)      // ANCOUNT
+	appendUint16(0)      // NSCOUNT
+	appendUint16(0)      // ARCOUNT
+
+	buf = append(buf, qname...)
+	appendUint16(dnsTypeSRV)
+	appendUint16(dnsClassINET)
+
+	buf = append(buf, 0xC0, 0x0C) // pointer to the question's name at offset 12
+	appendUint16(dnsTypeSRV)
+	appendUint16(dnsClassINET)
+	appendUint32(ttl)
+
+	target, err := encodeName(srv.Target)
+	if err != nil {
+		t.Fatalf("encodeName(target): %v", err)
+	}
+	rdata := make([]byte, 0, 6+len(target))
+	rdata = binary.BigEndian.AppendUint16(rdata, srv.Priority)
+	rdata = binary.BigEndian.AppendUint16(rdata, srv.Weight)
+	rdata = binary.BigEndian.AppendUint16(rdata, srv.Port)
+	rdata = append(rdata, target...)
+
+	appendUint16(uint16(len(rdata)))
+	buf = append(buf, rdata...)
+
+	return buf
+}
+
+func TestParseSRVAnswer(t *testing.T) {
+	msg := buildSRVResponse(t, "_http._tcp.example.com.", struct {
+		Priority, Weight, Port uint16
+		Target                 string
+	}{Priority: 10, Weight: 100, Port: 8080, Target: "node1.example.com."}, 300)
+
+	addrs, ttl, err := parseSRVAnswer(msg)
+	if err != nil {
+		t.Fatalf("parseSRVAnswer failed: %v", err)
+	}
+	if len(addrs) != 1 {
+		t.Fatalf("expected 1 SRV record, got %d", len(addrs))
+	}
+	if addrs[0].Target != "node1.example.com." || addrs[0].Port != 8080 || addrs[0].Priority != 10 || addrs[0].Weight != 100 {
+		t.Errorf("unexpected SRV record: %+v", addrs[0])
+	}
+	if ttl != 300*time.Second {
+		t.Errorf("expected ttl 300s, got %v", ttl)
+	}
+}
+
+func TestParseSRVAnswer_ResponseCodeError(t *testing.T) {
+	msg := buildSRVResponse(t, "example.com.", struct {
+		Priority, Weight, Port uint16
+		Target                 string
+	}{Target: "node1.example.com."}, 60)
+	msg[3] = (msg[3] &^ 0x0F) | 3 // NXDOMAIN
+
+	if _, _, err := parseSRVAnswer(msg); err == nil {
+		t.Fatal("expected an error for a non-zero response code, got nil")
+	}
+}
+
+func TestResolver_LookupSRV_POST(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("expected POST, got %s", r.Method)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != dnsMessageContentType {
+			t.Errorf("expected Content-Type %s, got %s", dnsMessageContentType, ct)
+		}
+		query, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("reading query body: %v", err)
+		}
+		name, _, err := readName(query, 12)
+		if err != nil {
+			t.Fatalf("reading query name: %v", err)
+		}
+
+		resp := buildSRVResponse(t, name, struct {
+			Priority, Weight, Port uint16
+			Target                 string
+		}{Priority: 10, Weight: 100, Port: 8080, Target: "node1.example.com."}, 300)
+		w.Header().Set("Content-Type", dnsMessageContentType)
+		w.Write(resp)
+	}))
+	defer server.Close()
+
+	resolver := NewResolver(server.URL)
+	cname, addrs, ttl, err := resolver.LookupSRV(context.Background(), "http", "tcp", "example.com")
+	if err != nil {
+		t.Fatalf("LookupSRV failed: %v", err)
+	}
+	if cname != "_http._tcp.example.com." {
+		t.Errorf("expected cname _http._tcp.example.com., got %s", cname)
+	}
+	if len(addrs) != 1 || addrs[0].Target != "node1.example.com." {
+		t.Errorf("unexpected addrs: %v", addrs)
+	}
+	if ttl != 300*time.Second {
+		t.Errorf("expected ttl 300s, got %v", ttl)
+	}
+}
+
+func TestResolver_LookupSRV_GET(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("expected GET, got %s", r.Method)
+		}
+		if r.URL.Query().Get("dns") == "" {
+			t.Fatal("expected a dns query parameter")
+		}
+
+		resp := buildSRVResponse(t, "example.com.", struct {
+			Priority, Weight, Port uint16
+			Target                 string
+		}{Priority: 10, Weight: 100, Port: 443, Target: "node1.example.com."}, 60)
+		w.Header().Set("Content-Type", dnsMessageContentType)
+		w.Write(resp)
+	}))
+	defer server.Close()
+
+	resolver := NewResolver(server.URL, WithMethod(http.MethodGet), WithHTTPClient(server.Client()))
+	_, addrs, _, err := resolver.LookupSRV(context.Background(), "", "", "example.com")
+	if err != nil {
+		t.Fatalf("LookupSRV failed: %v", err)
+	}
+	if len(addrs) != 1 || addrs[0].Port != 443 {
+		t.Errorf("unexpected addrs: %v", addrs)
+	}
+}
+
+func TestResolver_LookupSRV_GET_PreservesExistingQueryParams(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("api_key"); got != "secret" {
+			t.Errorf("expected the endpoint's existing api_key param to be preserved, got %q", got)
+		}
+		if r.URL.Query().Get("dns") == "" {
+			t.Fatal("expected a dns query parameter")
+		}
+
+		resp := buildSRVResponse(t, "example.com.", struct {
+			Priority, Weight, Port uint16
+			Target                 string
+		}{Priority: 10, Weight: 100, Port: 443, Target: "node1.example.com."}, 60)
+		w.Header().Set("Content-Type", dnsMessageContentType)
+		w.Write(resp)
+	}))
+	defer server.Close()
+
+	resolver := NewResolver(server.URL+"?api_key=secret", WithMethod(http.MethodGet), WithHTTPClient(server.Client()))
+	_, addrs, _, err := resolver.LookupSRV(context.Background(), "", "", "example.com")
+	if err != nil {
+		t.Fatalf("LookupSRV failed: %v", err)
+	}
+	if len(addrs) != 1 || addrs[0].Port != 443 {
+		t.Errorf("unexpected addrs: %v", addrs)
+	}
+}
+
+func TestReadName_CompressionPointerLoop(t *testing.T) {
+	// A 14-byte message whose only name starts at offset 12 and is a pointer
+	// back at itself: readName must detect the cycle instead of looping forever.
+	msg := make([]byte, 14)
+	msg[12] = 0xC0
+	msg[13] = 0x0C
+
+	done := make(chan struct{})
+	var err error
+	go func() {
+		_, _, err = readName(msg, 12)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("readName did not return within 2s on a self-referencing compression pointer")
+	}
+	if err == nil {
+		t.Fatal("expected an error for a compression pointer loop, got nil")
+	}
+}
+
+func TestResolver_LookupSRV_HTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	resolver := NewResolver(server.URL)
+	if _, _, _, err := resolver.LookupSRV(context.Background(), "", "", "example.com"); err == nil {
+		t.Fatal("expected an error for a non-200 response, got nil")
+	}
+}
@@ -0,0 +1,156 @@
+package httpsrv
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// Resolver looks up the SRV records for a service, the way net.Resolver.LookupSRV
+// does, but through an interface so callers can plug in their own DNS client,
+// a cache, or a fake for tests. The returned ttl is the duration the result may
+// be cached for; a zero ttl means the result must not be cached unless the
+// caller configures an explicit TTL (see WithCacheTTL).
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, ttl time.Duration, err error)
+}
+
+// netResolver is the default Resolver, backed by net.DefaultResolver.
+type netResolver struct{}
+
+func (netResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, time.Duration, error) {
+	cname, addrs, err := net.DefaultResolver.LookupSRV(ctx, service, proto, name)
+	return cname, addrs, 0, err
+}
+
+type cacheKey struct {
+	service, proto, name string
+}
+
+type cacheEntry struct {
+	cname   string
+	addrs   []*net.SRV
+	expires time.Time
+}
+
+// inflightCall lets concurrent lookups for the same key share a single
+// upstream call instead of hammering the resolver.
+type inflightCall struct {
+	done  chan struct{}
+	cname string
+	addrs []*net.SRV
+	ttl   time.Duration
+	err   error
+}
+
+// CachingResolver decorates a Resolver with an in-memory TTL cache, keyed by
+// (service, proto, name). Concurrent lookups for a key that isn't cached yet
+// are coalesced into a single call to the underlying Resolver. Entries are
+// swept out once they expire so the cache doesn't grow unbounded for
+// services that stop being queried.
+type CachingResolver struct {
+	resolver Resolver
+	ttl      time.Duration // used when the underlying Resolver doesn't provide its own TTL
+
+	mu       sync.Mutex
+	entries  map[cacheKey]cacheEntry
+	inflight map[cacheKey]*inflightCall
+}
+
+// CacheOption configures a CachingResolver.
+type CacheOption func(*CachingResolver)
+
+// WithCacheTTL sets the TTL used to cache a lookup when the wrapped Resolver
+// reports a zero TTL for it.
+func WithCacheTTL(d time.Duration) CacheOption {
+	return func(c *CachingResolver) { c.ttl = d }
+}
+
+// NewCachingResolver wraps resolver with a TTL cache and starts a background
+// goroutine that periodically sweeps expired entries. The goroutine runs for
+// the lifetime of the process; CachingResolver is intended to be created once
+// and reused, not constructed per request.
+func NewCachingResolver(resolver Resolver, opts ...CacheOption) *CachingResolver {
+	c := &CachingResolver{
+		resolver: resolver,
+		entries:  make(map[cacheKey]cacheEntry),
+		inflight: make(map[cacheKey]*inflightCall),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	sweepInterval := c.ttl
+	if sweepInterval <= 0 {
+		sweepInterval = time.Minute
+	}
+	go c.sweepLoop(sweepInterval)
+
+	return c
+}
+
+func (c *CachingResolver) sweepLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.sweep()
+	}
+}
+
+func (c *CachingResolver) sweep() {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func (c *CachingResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, time.Duration, error) {
+	key := cacheKey{service, proto, name}
+
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok {
+		if ttl := time.Until(entry.expires); ttl > 0 {
+			c.mu.Unlock()
+			return entry.cname, entry.addrs, ttl, nil
+		}
+		delete(c.entries, key)
+	}
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.cname, call.addrs, call.ttl, call.err
+		case <-ctx.Done():
+			return "", nil, 0, ctx.Err()
+		}
+	}
+	call := &inflightCall{done: make(chan struct{})}
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	cname, addrs, ttl, err := c.resolver.LookupSRV(ctx, service, proto, name)
+	if err == nil {
+		if ttl <= 0 {
+			ttl = c.ttl
+		}
+		if ttl > 0 {
+			c.mu.Lock()
+			c.entries[key] = cacheEntry{cname: cname, addrs: addrs, expires: time.Now().Add(ttl)}
+			c.mu.Unlock()
+		}
+	}
+
+	call.cname, call.addrs, call.ttl, call.err = cname, addrs, ttl, err
+	close(call.done)
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	c.mu.Unlock()
+
+	return cname, addrs, ttl, err
+}
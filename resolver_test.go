@@ -0,0 +1,152 @@
+package httpsrv
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCachingResolver_CachesWithinTTL(t *testing.T) {
+	var calls int
+	underlying := fakeResolver{
+		lookup: func(ctx context.Context, service, proto, name string) (string, []*net.SRV, time.Duration, error) {
+			calls++
+			return "cname.example.com", []*net.SRV{{Target: "node1.consul.", Port: 8080}}, time.Minute, nil
+		},
+	}
+	resolver := NewCachingResolver(underlying)
+
+	for i := 0; i < 3; i++ {
+		_, addrs, _, err := resolver.LookupSRV(context.Background(), "", "", "service.consul")
+		if err != nil {
+			t.Fatalf("LookupSRV failed: %v", err)
+		}
+		if len(addrs) != 1 || addrs[0].Target != "node1.consul." {
+			t.Fatalf("unexpected addrs: %v", addrs)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected the underlying resolver to be called once, called %d times", calls)
+	}
+}
+
+func TestCachingResolver_ExpiresAfterTTL(t *testing.T) {
+	var calls int
+	underlying := fakeResolver{
+		lookup: func(ctx context.Context, service, proto, name string) (string, []*net.SRV, time.Duration, error) {
+			calls++
+			return "cname.example.com", []*net.SRV{{Target: "node1.consul.", Port: 8080}}, time.Millisecond, nil
+		},
+	}
+	resolver := NewCachingResolver(underlying)
+
+	if _, _, _, err := resolver.LookupSRV(context.Background(), "", "", "service.consul"); err != nil {
+		t.Fatalf("LookupSRV failed: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, _, _, err := resolver.LookupSRV(context.Background(), "", "", "service.consul"); err != nil {
+		t.Fatalf("LookupSRV failed: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected the underlying resolver to be called again after TTL expiry, called %d times", calls)
+	}
+}
+
+func TestCachingResolver_UsesOptionTTLWhenResolverReturnsZero(t *testing.T) {
+	var calls int
+	underlying := fakeResolver{
+		lookup: func(ctx context.Context, service, proto, name string) (string, []*net.SRV, time.Duration, error) {
+			calls++
+			return "cname.example.com", []*net.SRV{{Target: "node1.consul.", Port: 8080}}, 0, nil
+		},
+	}
+	resolver := NewCachingResolver(underlying, WithCacheTTL(time.Minute))
+
+	resolver.LookupSRV(context.Background(), "", "", "service.consul")
+	resolver.LookupSRV(context.Background(), "", "", "service.consul")
+	if calls != 1 {
+		t.Errorf("Expected the option TTL to be used for caching, underlying called %d times", calls)
+	}
+}
+
+func TestCachingResolver_DoesNotCacheErrors(t *testing.T) {
+	var calls int
+	expectedErr := errors.New("dns lookup failed")
+	underlying := fakeResolver{
+		lookup: func(ctx context.Context, service, proto, name string) (string, []*net.SRV, time.Duration, error) {
+			calls++
+			return "", nil, time.Minute, expectedErr
+		},
+	}
+	resolver := NewCachingResolver(underlying)
+
+	resolver.LookupSRV(context.Background(), "", "", "service.consul")
+	resolver.LookupSRV(context.Background(), "", "", "service.consul")
+	if calls != 2 {
+		t.Errorf("Expected errors not to be cached, underlying called %d times", calls)
+	}
+}
+
+func TestCachingResolver_CoalescesConcurrentLookups(t *testing.T) {
+	var calls int32
+	start := make(chan struct{})
+	underlying := fakeResolver{
+		lookup: func(ctx context.Context, service, proto, name string) (string, []*net.SRV, time.Duration, error) {
+			atomic.AddInt32(&calls, 1)
+			<-start
+			return "cname.example.com", []*net.SRV{{Target: "node1.consul.", Port: 8080}}, time.Minute, nil
+		},
+	}
+	resolver := NewCachingResolver(underlying)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resolver.LookupSRV(context.Background(), "", "", "service.consul")
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("Expected concurrent lookups for the same key to be coalesced into one call, got %d", got)
+	}
+}
+
+func TestCachingResolver_CoalescedCallerRespectsOwnContext(t *testing.T) {
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	underlying := fakeResolver{
+		lookup: func(ctx context.Context, service, proto, name string) (string, []*net.SRV, time.Duration, error) {
+			close(started)
+			<-unblock
+			return "cname.example.com", []*net.SRV{{Target: "node1.consul.", Port: 8080}}, time.Minute, nil
+		},
+	}
+	resolver := NewCachingResolver(underlying)
+	defer close(unblock)
+
+	go resolver.LookupSRV(context.Background(), "", "", "service.consul")
+	<-started // wait until the first lookup is in flight and holding unblock
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, _, err := resolver.LookupSRV(ctx, "", "", "service.consul")
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded from the coalesced caller's own context, got: %v", err)
+	}
+	if elapsed > 200*time.Millisecond {
+		t.Errorf("Expected the coalesced caller to return promptly on its own context deadline, took %v", elapsed)
+	}
+}
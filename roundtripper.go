@@ -1,29 +1,145 @@
 package httpsrv
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand"
 	"net"
 	"net/http"
+	"strings"
 )
 
-var lookupSRV = net.LookupSRV // Allow overriding for tests
+// Selector picks one SRV record to try next out of the set of records that
+// have not yet been attempted. Implementations are called repeatedly, once
+// per failed attempt, with the failed record already removed from rrs.
+type Selector interface {
+	Pick(rrs []*net.SRV) *net.SRV
+}
+
+// rfc2782Selector implements the selection algorithm described in RFC 2782:
+// records are tried in ascending Priority order, and within a Priority the
+// next target is chosen by weighted random selection, with Weight 0 records
+// given a (small) chance ahead of the rest.
+type rfc2782Selector struct{}
+
+func (rfc2782Selector) Pick(rrs []*net.SRV) *net.SRV {
+	if len(rrs) == 0 {
+		return nil
+	}
+	lowest := rrs[0].Priority
+	for _, rr := range rrs[1:] {
+		if rr.Priority < lowest {
+			lowest = rr.Priority
+		}
+	}
+
+	group := make([]*net.SRV, 0, len(rrs))
+	for _, rr := range rrs {
+		if rr.Priority == lowest && rr.Weight == 0 {
+			group = append(group, rr)
+		}
+	}
+	for _, rr := range rrs {
+		if rr.Priority == lowest && rr.Weight != 0 {
+			group = append(group, rr)
+		}
+	}
+
+	var total int
+	running := make([]int, len(group))
+	for i, rr := range group {
+		total += int(rr.Weight)
+		running[i] = total
+	}
+
+	pick := rand.Intn(total + 1) // 0..total inclusive, per RFC 2782
+	for i, sum := range running {
+		if sum >= pick {
+			return group[i]
+		}
+	}
+	return group[len(group)-1]
+}
 
 type srvRoundTripper struct {
 	original http.RoundTripper
+	selector Selector
+	resolver Resolver
+}
+
+// Option configures a srvRoundTripper constructed via AddSRVRoundTripperWithOptions.
+type Option func(*srvRoundTripper)
+
+// WithResolver overrides the Resolver used to look up SRV records. The
+// default resolves through net.DefaultResolver and does not cache; wrap it
+// (or any other Resolver) in a CachingResolver to add caching.
+func WithResolver(r Resolver) Option {
+	return func(s *srvRoundTripper) { s.resolver = r }
+}
+
+// WithSelector overrides the Selector used to pick which SRV target to try
+// next. The default follows the RFC 2782 priority/weight algorithm; inject a
+// custom Selector for deterministic target selection in tests.
+func WithSelector(sel Selector) Option {
+	return func(s *srvRoundTripper) { s.selector = sel }
+}
+
+// bufferBody reads req.Body into memory and returns a function that yields a
+// fresh copy of it, so the body can be replayed against multiple SRV targets.
+// req.GetBody is used when the caller already provides one.
+func bufferBody(req *http.Request) (func() (io.ReadCloser, error), error) {
+	if req.GetBody != nil {
+		return req.GetBody, nil
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("httpsrv: buffering request body: %w", err)
+	}
+	return func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}, nil
+}
+
+// splitServiceHostname recognizes an explicit "_service._proto." prefix, as used in
+// RFC 2782 SRV names (e.g. "_http._tcp.api.example.com"), and splits it into the
+// service, proto and remaining name to pass to Resolver.LookupSRV. When hostname
+// has no such prefix, it is returned unchanged as name, with service and proto
+// empty, matching the previous "name-only" lookup behaviour.
+func splitServiceHostname(hostname string) (service, proto, name string) {
+	labels := strings.SplitN(hostname, ".", 3)
+	if len(labels) == 3 && strings.HasPrefix(labels[0], "_") && strings.HasPrefix(labels[1], "_") {
+		return labels[0][1:], labels[1][1:], labels[2]
+	}
+	return "", "", hostname
+}
+
+// cloneRequest returns a copy of req, deep-copying req.URL and the header map,
+// so that the caller's request is left untouched. http.RoundTripper
+// implementations must not modify the request they are given.
+func cloneRequest(req *http.Request) *http.Request {
+	return req.Clone(req.Context())
 }
 
 func (s *srvRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	scheme := req.URL.Scheme
-	if scheme == "https+srv" {
-		req.URL.Scheme = "https"
-	} else if scheme == "http+srv" {
-		req.URL.Scheme = "http"
-	} else {
-		return nil, fmt.Errorf("unknown scheme %s", scheme)
+	var targetScheme string
+	switch req.URL.Scheme {
+	case "https+srv":
+		targetScheme = "https"
+	case "http+srv":
+		targetScheme = "http"
+	default:
+		return nil, fmt.Errorf("unknown scheme %s", req.URL.Scheme)
 	}
 
 	hostname := req.URL.Hostname()
-	_, rrs, err := lookupSRV("", "", hostname) // Use the overrideable function
+	service, proto, name := splitServiceHostname(hostname)
+	_, rrs, _, err := s.resolver.LookupSRV(req.Context(), service, proto, name)
 	if err != nil {
 		return nil, err
 	}
@@ -31,20 +147,65 @@ func (s *srvRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	if len(rrs) == 0 {
 		return nil, fmt.Errorf("SRV lookup for %s returned no records", hostname)
 	}
-	req.URL.Host = fmt.Sprintf("%s:%d", rrs[0].Target, rrs[0].Port)
 
-	return s.original.RoundTrip(req)
+	clone := cloneRequest(req)
+	clone.URL.Scheme = targetScheme
+
+	getBody, err := bufferBody(clone)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := append([]*net.SRV(nil), rrs...)
+	var errs []error
+	for len(remaining) > 0 {
+		target := s.selector.Pick(remaining)
+		for i, rr := range remaining {
+			if rr == target {
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				break
+			}
+		}
+
+		clone.URL.Host = fmt.Sprintf("%s:%d", target.Target, target.Port)
+		if getBody != nil {
+			if clone.Body, err = getBody(); err != nil {
+				return nil, fmt.Errorf("httpsrv: rewinding request body for %s: %w", clone.URL.Host, err)
+			}
+		}
+
+		resp, err := s.original.RoundTrip(clone)
+		if err == nil {
+			return resp, nil
+		}
+		errs = append(errs, fmt.Errorf("%s:%d: %w", target.Target, target.Port, err))
+	}
+
+	return nil, fmt.Errorf("httpsrv: all SRV targets for %s failed: %w", hostname, errors.Join(errs...))
 }
 
 // AddSRVRoundTripper adds a round tripper to the transport that handles https+srv and http+srv schemes.
-// The round tripper will resolve the SRV records via default resolver and use the first result (host and port).
+// The round tripper will resolve the SRV records via the default resolver and select a target following
+// the RFC 2782 priority/weight algorithm, retrying against the remaining targets on network errors.
 // The original round tripper will be used for the actual request.
-// Example:
+// Examples:
 //
 //	http+srv://simple.service.consul/healthz -> http://ac1e1409.addr.lon.consul.:31883/healthz
+//	http+srv://_http._tcp.api.example.com/healthz -> SRV query for _http._tcp.api.example.com
 func AddSRVRoundTripper(original http.RoundTripper, transport *http.Transport) {
+	AddSRVRoundTripperWithOptions(original, transport)
+}
+
+// AddSRVRoundTripperWithOptions is like AddSRVRoundTripper but allows overriding
+// the defaults, e.g. WithResolver to plug in a CachingResolver or a custom DNS client.
+func AddSRVRoundTripperWithOptions(original http.RoundTripper, transport *http.Transport, opts ...Option) {
 	rtt := &srvRoundTripper{
 		original: original,
+		selector: rfc2782Selector{},
+		resolver: netResolver{},
+	}
+	for _, opt := range opts {
+		opt(rtt)
 	}
 	transport.RegisterProtocol("https+srv", rtt)
 	transport.RegisterProtocol("http+srv", rtt)
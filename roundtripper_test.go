@@ -1,6 +1,7 @@
 package httpsrv
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -9,9 +10,10 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
-// mockRoundTripper is a mock implementation of http.RoundTripper for testing.	
+// mockRoundTripper is a mock implementation of http.RoundTripper for testing.
 
 type mockRoundTripper struct {
 	roundTripFunc func(req *http.Request) (*http.Response, error)
@@ -33,17 +35,31 @@ func (m *mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error)
 	}, nil
 }
 
+// fakeResolver is a Resolver backed by a plain function, for mocking SRV lookups in tests.
+type fakeResolver struct {
+	lookup func(ctx context.Context, service, proto, name string) (string, []*net.SRV, time.Duration, error)
+}
+
+func (f fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, time.Duration, error) {
+	return f.lookup(ctx, service, proto, name)
+}
+
+// staticResolver always returns the same records, with no TTL.
+func staticResolver(cname string, addrs []*net.SRV, err error) fakeResolver {
+	return fakeResolver{
+		lookup: func(ctx context.Context, service, proto, name string) (string, []*net.SRV, time.Duration, error) {
+			return cname, addrs, 0, err
+		},
+	}
+}
+
 // TestAddSRVRoundTripper verifies that AddSRVRoundTripper correctly sets up
 // the srvRoundTripper for http+srv and https+srv schemes.
 func TestAddSRVRoundTripper(t *testing.T) {
-	// Store original lookupSRV and restore it after the test
-	originalLookupSRV := lookupSRV
-	defer func() { lookupSRV = originalLookupSRV }()
-
 	tests := []struct {
 		name       string
 		scheme     string
-		expectCall bool // whether our srvRoundTripper's lookupSRV should be called
+		expectCall bool // whether our srvRoundTripper's resolver should be called
 	}{
 		{"HTTP+SRV scheme", "http+srv", true},
 		{"HTTPS+SRV scheme", "https+srv", true},
@@ -54,16 +70,17 @@ func TestAddSRVRoundTripper(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			mockOriginalRT := &mockRoundTripper{}
 			transport := &http.Transport{}
-			AddSRVRoundTripper(mockOriginalRT, transport)
-
-			client := &http.Client{Transport: transport}
 
 			lookupCalled := false
-			// Mock lookupSRV to check if it's called by our roundtripper
-			lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
-				lookupCalled = true
-				return "", nil, errors.New("mock SRV lookup error") // Return error to stop further processing
+			resolver := fakeResolver{
+				lookup: func(ctx context.Context, service, proto, name string) (string, []*net.SRV, time.Duration, error) {
+					lookupCalled = true
+					return "", nil, 0, errors.New("mock SRV lookup error") // Return error to stop further processing
+				},
 			}
+			AddSRVRoundTripperWithOptions(mockOriginalRT, transport, WithResolver(resolver))
+
+			client := &http.Client{Transport: transport}
 
 			// Create a dummy server that the original roundtripper would hit if not for SRV error
 			dummyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -88,30 +105,26 @@ func TestAddSRVRoundTripper(t *testing.T) {
 
 			if tt.expectCall {
 				if !lookupCalled {
-					t.Errorf("Expected lookupSRV to be called for scheme %s, but it wasn't", tt.scheme)
+					t.Errorf("Expected the resolver to be called for scheme %s, but it wasn't", tt.scheme)
 				}
 				if err == nil || !strings.Contains(err.Error(), "mock SRV lookup error") {
 					t.Errorf("Expected error from mock SRV lookup for scheme %s, got: %v", tt.scheme, err)
 				}
 			} else {
 				if lookupCalled {
-					t.Errorf("Expected lookupSRV NOT to be called for scheme %s, but it was", tt.scheme)
+					t.Errorf("Expected the resolver NOT to be called for scheme %s, but it was", tt.scheme)
 				}
 				// For non-SRV schemes, the request might succeed or fail depending on example.com and default transport behavior.
-				// The key is that our SRV logic (and thus lookupSRV mock) wasn't invoked.
+				// The key is that our SRV logic (and thus the resolver mock) wasn't invoked.
 			}
 		})
 	}
 }
 
 func TestSRVRoundTripper_RoundTrip(t *testing.T) {
-	// Store original lookupSRV and restore it after each subtest group or test
-	originalLookupSRV := lookupSRV
-	defer func() { lookupSRV = originalLookupSRV }()
-
 	t.Run("UnknownScheme", func(t *testing.T) {
 		mockOrigRT := &mockRoundTripper{}
-		rt := &srvRoundTripper{original: mockOrigRT}
+		rt := &srvRoundTripper{original: mockOrigRT, selector: rfc2782Selector{}}
 		req := httptest.NewRequest("GET", "ftp+srv://example.com/path", nil)
 
 		_, err := rt.RoundTrip(req)
@@ -129,13 +142,12 @@ func TestSRVRoundTripper_RoundTrip(t *testing.T) {
 
 	t.Run("SRVLookupError", func(t *testing.T) {
 		mockOrigRT := &mockRoundTripper{}
-		rt := &srvRoundTripper{original: mockOrigRT}
 		expectedErr := errors.New("dns lookup failed")
-
-		lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
-			return "", nil, expectedErr
+		rt := &srvRoundTripper{
+			original: mockOrigRT,
+			selector: rfc2782Selector{},
+			resolver: staticResolver("", nil, expectedErr),
 		}
-		defer func() { lookupSRV = originalLookupSRV }() // Restore for next test
 
 		req := httptest.NewRequest("GET", "http+srv://service.consul/path", nil)
 		_, err := rt.RoundTrip(req)
@@ -149,14 +161,12 @@ func TestSRVRoundTripper_RoundTrip(t *testing.T) {
 	})
 
 	t.Run("SRVLookupReturnsNoRecords", func(t *testing.T) {
-		// This test assumes the recommended change to handle empty SRV records is made.
 		mockOrigRT := &mockRoundTripper{}
-		rt := &srvRoundTripper{original: mockOrigRT}
-
-		lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
-			return "cname.example.com", []*net.SRV{}, nil // No records
+		rt := &srvRoundTripper{
+			original: mockOrigRT,
+			selector: rfc2782Selector{},
+			resolver: staticResolver("cname.example.com", []*net.SRV{}, nil),
 		}
-		defer func() { lookupSRV = originalLookupSRV }()
 
 		req := httptest.NewRequest("GET", "http+srv://service.consul/path", nil)
 		_, err := rt.RoundTrip(req)
@@ -177,6 +187,9 @@ func TestSRVRoundTripper_RoundTrip(t *testing.T) {
 		originalScheme     string
 		expectedScheme     string
 		srvHostname        string
+		expectedService    string
+		expectedProto      string
+		expectedLookupName string
 		srvPort            uint16
 		srvTarget          string // May include trailing dot
 		expectedHostInURL  string
@@ -187,6 +200,7 @@ func TestSRVRoundTripper_RoundTrip(t *testing.T) {
 			originalScheme:     "http+srv",
 			expectedScheme:     "http",
 			srvHostname:        "api.service.consul",
+			expectedLookupName: "api.service.consul",
 			srvPort:            8080,
 			srvTarget:          "node1.consul.", // Note trailing dot
 			expectedHostInURL:  "node1.consul.:8080",
@@ -197,11 +211,25 @@ func TestSRVRoundTripper_RoundTrip(t *testing.T) {
 			originalScheme:     "https+srv",
 			expectedScheme:     "https",
 			srvHostname:        "secure.service.consul",
+			expectedLookupName: "secure.service.consul",
 			srvPort:            8443,
 			srvTarget:          "secure-node.internal", // No trailing dot
 			expectedHostInURL:  "secure-node.internal:8443",
 			requestPath:        "/status",
 		},
+		{
+			name:               "explicit _service._proto lookup",
+			originalScheme:     "http+srv",
+			expectedScheme:     "http",
+			srvHostname:        "_http._tcp.api.example.com",
+			expectedService:    "http",
+			expectedProto:      "tcp",
+			expectedLookupName: "api.example.com",
+			srvPort:            8080,
+			srvTarget:          "node1.consul.",
+			expectedHostInURL:  "node1.consul.:8080",
+			requestPath:        "/healthz",
+		},
 	}
 
 	for _, tt := range successTestCases {
@@ -221,18 +249,19 @@ func TestSRVRoundTripper_RoundTrip(t *testing.T) {
 					return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("ok"))}, nil
 				},
 			}
-			rt := &srvRoundTripper{original: mockOrigRT}
-
-			lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
-				if name != tt.srvHostname {
-					t.Fatalf("lookupSRV called with unexpected hostname: got %s, want %s", name, tt.srvHostname)
-				}
-				return "cname.example.com", []*net.SRV{
-					{Target: tt.srvTarget, Port: tt.srvPort, Priority: 10, Weight: 100},
-					{Target: "other.target.consul", Port: 9090, Priority: 20, Weight: 100}, // Ensure first is used
-				}, nil
+			resolver := fakeResolver{
+				lookup: func(ctx context.Context, service, proto, name string) (string, []*net.SRV, time.Duration, error) {
+					if service != tt.expectedService || proto != tt.expectedProto || name != tt.expectedLookupName {
+						t.Fatalf("resolver called with unexpected service/proto/name: got (%q, %q, %q), want (%q, %q, %q)",
+							service, proto, name, tt.expectedService, tt.expectedProto, tt.expectedLookupName)
+					}
+					return "cname.example.com", []*net.SRV{
+						{Target: tt.srvTarget, Port: tt.srvPort, Priority: 10, Weight: 100},
+						{Target: "other.target.consul", Port: 9090, Priority: 20, Weight: 100}, // Ensure first is used
+					}, 0, nil
+				},
 			}
-			defer func() { lookupSRV = originalLookupSRV }()
+			rt := &srvRoundTripper{original: mockOrigRT, selector: rfc2782Selector{}, resolver: resolver}
 
 			initialURL := fmt.Sprintf("%s://%s%s", tt.originalScheme, tt.srvHostname, tt.requestPath)
 			req := httptest.NewRequest("GET", initialURL, nil)
@@ -259,14 +288,13 @@ func TestSRVRoundTripper_RoundTrip(t *testing.T) {
 				return nil, expectedErr
 			},
 		}
-		rt := &srvRoundTripper{original: mockOrigRT}
-
-		lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
-			return "cname.example.com", []*net.SRV{
+		rt := &srvRoundTripper{
+			original: mockOrigRT,
+			selector: rfc2782Selector{},
+			resolver: staticResolver("cname.example.com", []*net.SRV{
 				{Target: "target.host.", Port: 1234},
-			}, nil
+			}, nil),
 		}
-		defer func() { lookupSRV = originalLookupSRV }()
 
 		req := httptest.NewRequest("GET", "http+srv://service.consul/path", nil)
 		_, err := rt.RoundTrip(req)
@@ -278,4 +306,207 @@ func TestSRVRoundTripper_RoundTrip(t *testing.T) {
 			t.Errorf("Expected original RoundTripper to be called once, called %d times", mockOrigRT.callCount)
 		}
 	})
+
+	t.Run("FailoverToNextTarget", func(t *testing.T) {
+		var hostsTried []string
+		mockOrigRT := &mockRoundTripper{
+			roundTripFunc: func(req *http.Request) (*http.Response, error) {
+				hostsTried = append(hostsTried, req.URL.Host)
+				if req.URL.Host == "down.consul.:8080" {
+					return nil, errors.New("connection refused")
+				}
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			},
+		}
+		rt := &srvRoundTripper{
+			original: mockOrigRT,
+			selector: rfc2782Selector{},
+			resolver: staticResolver("cname.example.com", []*net.SRV{
+				{Target: "down.consul.", Port: 8080, Priority: 10, Weight: 100},
+				{Target: "backup.consul.", Port: 8080, Priority: 20, Weight: 100},
+			}, nil),
+		}
+
+		req := httptest.NewRequest("GET", "http+srv://service.consul/path", nil)
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip failed: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status OK, got %d", resp.StatusCode)
+		}
+		if len(hostsTried) != 2 || hostsTried[0] != "down.consul.:8080" || hostsTried[1] != "backup.consul.:8080" {
+			t.Errorf("Expected failover from down.consul. to backup.consul., got %v", hostsTried)
+		}
+	})
+
+	t.Run("FailoverToNextTargetPreservesRequestBody", func(t *testing.T) {
+		var hostsTried []string
+		var bodiesReceived []string
+		mockOrigRT := &mockRoundTripper{
+			roundTripFunc: func(req *http.Request) (*http.Response, error) {
+				hostsTried = append(hostsTried, req.URL.Host)
+				body, err := io.ReadAll(req.Body)
+				if err != nil {
+					t.Fatalf("reading request body: %v", err)
+				}
+				bodiesReceived = append(bodiesReceived, string(body))
+				if req.URL.Host == "down.consul.:8080" {
+					return nil, errors.New("connection refused")
+				}
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			},
+		}
+		rt := &srvRoundTripper{
+			original: mockOrigRT,
+			selector: rfc2782Selector{},
+			resolver: staticResolver("cname.example.com", []*net.SRV{
+				{Target: "down.consul.", Port: 8080, Priority: 10, Weight: 100},
+				{Target: "backup.consul.", Port: 8080, Priority: 20, Weight: 100},
+			}, nil),
+		}
+
+		req := httptest.NewRequest("POST", "http+srv://service.consul/path", strings.NewReader("some body"))
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip failed: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status OK, got %d", resp.StatusCode)
+		}
+		if len(hostsTried) != 2 || hostsTried[0] != "down.consul.:8080" || hostsTried[1] != "backup.consul.:8080" {
+			t.Errorf("Expected failover from down.consul. to backup.consul., got %v", hostsTried)
+		}
+		if len(bodiesReceived) != 2 || bodiesReceived[0] != "some body" || bodiesReceived[1] != "some body" {
+			t.Errorf("Expected both targets to receive the same request body %q, got %v", "some body", bodiesReceived)
+		}
+	})
+
+	t.Run("AllTargetsExhausted", func(t *testing.T) {
+		mockOrigRT := &mockRoundTripper{
+			roundTripFunc: func(req *http.Request) (*http.Response, error) {
+				return nil, errors.New("connection refused")
+			},
+		}
+		rt := &srvRoundTripper{
+			original: mockOrigRT,
+			selector: rfc2782Selector{},
+			resolver: staticResolver("cname.example.com", []*net.SRV{
+				{Target: "one.consul.", Port: 8080, Priority: 10, Weight: 100},
+				{Target: "two.consul.", Port: 8080, Priority: 20, Weight: 100},
+			}, nil),
+		}
+
+		req := httptest.NewRequest("GET", "http+srv://service.consul/path", nil)
+		_, err := rt.RoundTrip(req)
+
+		if err == nil {
+			t.Fatal("Expected an error when all SRV targets fail, got nil")
+		}
+		if !strings.Contains(err.Error(), "one.consul.") || !strings.Contains(err.Error(), "two.consul.") {
+			t.Errorf("Expected error to list both attempted targets, got: %s", err.Error())
+		}
+		if mockOrigRT.callCount != 2 {
+			t.Errorf("Expected original RoundTripper to be called twice, called %d times", mockOrigRT.callCount)
+		}
+	})
+
+	t.Run("WeightedSelectionFavorsHigherWeight", func(t *testing.T) {
+		selector := rfc2782Selector{}
+		rrs := []*net.SRV{
+			{Target: "light.consul.", Port: 80, Priority: 0, Weight: 1},
+			{Target: "heavy.consul.", Port: 80, Priority: 0, Weight: 99},
+		}
+		counts := map[string]int{}
+		for i := 0; i < 1000; i++ {
+			pick := selector.Pick(rrs)
+			counts[pick.Target]++
+		}
+		if counts["heavy.consul."] < counts["light.consul."] {
+			t.Errorf("Expected heavier-weighted record to be picked more often, got %v", counts)
+		}
+	})
+
+	t.Run("ZeroWeightRecordsAreSelectable", func(t *testing.T) {
+		selector := rfc2782Selector{}
+		rrs := []*net.SRV{
+			{Target: "zero.consul.", Port: 80, Priority: 0, Weight: 0},
+		}
+		pick := selector.Pick(rrs)
+		if pick == nil || pick.Target != "zero.consul." {
+			t.Errorf("Expected zero-weight record to be selectable, got %v", pick)
+		}
+	})
+
+	t.Run("DoesNotMutateCallerRequest", func(t *testing.T) {
+		mockOrigRT := &mockRoundTripper{}
+		rt := &srvRoundTripper{
+			original: mockOrigRT,
+			selector: rfc2782Selector{},
+			resolver: staticResolver("cname.example.com", []*net.SRV{
+				{Target: "node1.consul.", Port: 8080, Priority: 10, Weight: 100},
+			}, nil),
+		}
+
+		req := httptest.NewRequest("GET", "http+srv://service.consul/path", nil)
+		originalURL := *req.URL
+
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if req.URL.Scheme != "http+srv" {
+			t.Errorf("Expected caller's req.URL.Scheme to remain http+srv, got %s", req.URL.Scheme)
+		}
+		if req.URL.Host != originalURL.Host {
+			t.Errorf("Expected caller's req.URL.Host to remain %s, got %s", originalURL.Host, req.URL.Host)
+		}
+		if mockOrigRT.lastRequest == req {
+			t.Error("Expected the original RoundTripper to receive a clone, not the caller's request")
+		}
+		if mockOrigRT.lastRequest.URL.Scheme != "http" {
+			t.Errorf("Expected the cloned request's scheme to be resolved to http, got %s", mockOrigRT.lastRequest.URL.Scheme)
+		}
+		if mockOrigRT.lastRequest.URL.Host != "node1.consul.:8080" {
+			t.Errorf("Expected the cloned request's host to be the SRV target, got %s", mockOrigRT.lastRequest.URL.Host)
+		}
+	})
+
+	t.Run("LowerPriorityGroupPreferred", func(t *testing.T) {
+		selector := rfc2782Selector{}
+		rrs := []*net.SRV{
+			{Target: "backup.consul.", Port: 80, Priority: 20, Weight: 100},
+			{Target: "primary.consul.", Port: 80, Priority: 10, Weight: 100},
+		}
+		pick := selector.Pick(rrs)
+		if pick.Target != "primary.consul." {
+			t.Errorf("Expected lowest-priority record to be picked first, got %s", pick.Target)
+		}
+	})
+}
+
+func TestSplitServiceHostname(t *testing.T) {
+	tests := []struct {
+		hostname        string
+		expectedService string
+		expectedProto   string
+		expectedName    string
+	}{
+		{"_http._tcp.api.example.com", "http", "tcp", "api.example.com"},
+		{"_https._tcp.example.com", "https", "tcp", "example.com"},
+		{"api.service.consul", "", "", "api.service.consul"},
+		{"simple.service.consul", "", "", "simple.service.consul"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.hostname, func(t *testing.T) {
+			service, proto, name := splitServiceHostname(tt.hostname)
+			if service != tt.expectedService || proto != tt.expectedProto || name != tt.expectedName {
+				t.Errorf("splitServiceHostname(%q) = (%q, %q, %q), want (%q, %q, %q)",
+					tt.hostname, service, proto, name, tt.expectedService, tt.expectedProto, tt.expectedName)
+			}
+		})
+	}
 }